@@ -0,0 +1,165 @@
+package goopt
+
+// Here are the flags that goopt adds to every program.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// A Builtin is one of the flags that goopt adds for you.  Change its
+// fields before calling Parse to rename, hide or disable it, or to
+// give it your own handler.
+type Builtin struct {
+	Enabled bool
+	Names   []string           // e.g. --help -h
+	Help    string             // the help text (automatically Expand()ed)
+	Hidden  bool               // if true, it is left out of Help() and the man page
+	Handler func(string) error // if not nil, this is called instead of the usual action
+}
+
+// Display the generated help message (calls Usage()), or the help on
+// a topic (see HelpTopic)
+var HelpFlag = &Builtin{Enabled: true, Names: []string{"--help"},
+	Help: "Show usage message, or help on TOPIC"}
+
+// Display the generated help message for the Basic options only
+var BriefHelpFlag = &Builtin{Enabled: true, Names: []string{"-h"},
+	Help: "Show brief usage message"}
+
+// Display Version
+var VersionFlag = &Builtin{Enabled: true, Names: []string{"--version"},
+	Help: "Show version"}
+
+// List all known flags, one per line, for use by shell completion
+var ListOptionsFlag = &Builtin{Enabled: true, Names: []string{"--list-options"},
+	Help: "List all known flags", Hidden: true}
+
+// Display a manpage generated by the goopt library (uses Author, Suite, etc)
+var CreateManpageFlag = &Builtin{Enabled: true, Names: []string{"--create-manpage"},
+	Help: "Create a man page", Hidden: true}
+
+// Print the value of every option along with where that value came from
+var PrintConfigFlag = &Builtin{Names: []string{"--print-config"},
+	Help: "Print the value of each option and where it came from, as text or json"}
+
+// Write the current options out in a form that LoadConfig can read
+var WriteConfigFlag = &Builtin{Names: []string{"--write-config"},
+	Help: "Write the options given to FILE (or - for stdout) as a config file"}
+
+// Choose when help and errors are coloured (see Color)
+var ColorFlag = &Builtin{Names: []string{"--color"},
+	Help: "Colour help and errors: WHEN is always, never or auto"}
+
+// Allow the use of experimental options.  This is only added if there
+// are any (see Experimental).
+var ExperimentalFlag = &Builtin{Enabled: true, Names: []string{"--enable-experimental"},
+	Help: "Allow the use of experimental options"}
+
+var builtinsAdded = false
+
+// The extra options passed to Parse, for --list-options.
+var extraOptions func() []string
+
+// What --print-config and --write-config asked for, which is done once
+// all the other flags have been processed.
+var printConfigFormat, writeConfigFile string
+
+// addBuiltins adds the builtin flags to opts, the first time it is
+// called.
+func addBuiltins() {
+	if builtinsAdded {
+		return
+	}
+	builtinsAdded = true
+	topic := "TOPIC"
+	HelpFlag.add(&topic, false, showHelp)
+	BriefHelpFlag.add(nil, false, func(string) error {
+		defer paintingFor(Stdout)()
+		fmt.Fprintln(Stdout, usageAt(Basic))
+		exit(0)
+		return nil
+	})
+	VersionFlag.add(nil, false, func(string) error {
+		fmt.Fprintln(Stdout, Version)
+		exit(0)
+		return nil
+	})
+	ListOptionsFlag.add(nil, false, func(string) error {
+		if extraOptions != nil {
+			for _, o := range extraOptions() {
+				fmt.Fprintln(Stdout, o)
+			}
+		}
+		VisitAllNames(func(n string) { fmt.Fprintln(Stdout, n) })
+		exit(0)
+		return nil
+	})
+	CreateManpageFlag.add(nil, false, func(string) error {
+		makeManpage()
+		exit(0)
+		return nil
+	})
+	text := "text"
+	PrintConfigFlag.add(&text, false, func(f string) error {
+		if f == "" {
+			f = "text"
+		}
+		if f != "text" && f != "json" {
+			return errors.New("unknown format: " + f)
+		}
+		printConfigFormat = f
+		return nil
+	})
+	for _, o := range opts {
+		if o.experimental {
+			ExperimentalFlag.add(nil, false, func(string) error {
+				allowExperiments()
+				return nil
+			})
+			break
+		}
+	}
+	when := "WHEN"
+	ColorFlag.add(&when, false, setColor)
+	file := "FILE"
+	WriteConfigFlag.add(&file, true, func(f string) error {
+		writeConfigFile = f
+		return nil
+	})
+}
+
+func (b *Builtin) add(arg *string, needsArg bool, action func(string) error) {
+	if !b.Enabled || len(b.Names) == 0 {
+		return
+	}
+	if b.Handler != nil {
+		action = b.Handler
+	}
+	// an optional argument must be attached, so that --help doesn't
+	// swallow the word after it
+	addOpt(opt{names: b.Names, help: b.Help, needsArg: needsArg, allowsArg: arg,
+		process: action, builtin: b, hidden: b.Hidden, attached: !needsArg})
+}
+
+// finishBuiltins does what --print-config and --write-config asked for.
+func finishBuiltins() {
+	if writeConfigFile == "-" {
+		failnoting("Error writing config:", WriteConfig(Stdout))
+		exit(0)
+	} else if writeConfigFile != "" {
+		f, err := os.Create(writeConfigFile)
+		failnoting("Error writing config:", err)
+		err = WriteConfig(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		failnoting("Error writing config:", err)
+		exit(0)
+	}
+	if printConfigFormat != "" {
+		failnoting("Error printing config:", DumpConfig(Stdout, printConfigFormat))
+		exit(0)
+	}
+}
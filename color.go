@@ -0,0 +1,139 @@
+package goopt
+
+// Here we colour the help and error messages, when that is wanted.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// A ColorMode says when help and errors are coloured.
+type ColorMode int
+
+const (
+	// Colour output to a terminal, unless $NO_COLOR is set or $TERM is
+	// dumb.
+	ColorAuto ColorMode = iota
+	// Always colour the output.
+	ColorAlways
+	// Never colour the output.
+	ColorNever
+)
+
+// Redefine this to change when help and errors are coloured.  It is
+// also set by --color (see ColorFlag).
+var Color = ColorAuto
+
+// A Theme holds the ANSI escape sequences (e.g. "\x1b[1m" for bold)
+// that start each kind of coloured output.  An empty one leaves that
+// kind plain.
+type Theme struct {
+	Heading string // e.g. "Options:"
+	Flag    string // the names of options
+	Arg     string // the labels of arguments
+	Error   string // the program's name before an error
+	Warning string // "Warning:"
+}
+
+// Redefine this to change the colours used
+var Colors = Theme{Heading: "\x1b[1m", Flag: "\x1b[1;36m", Arg: "\x1b[33m",
+	Error: "\x1b[1;31m", Warning: "\x1b[1;33m"}
+
+// Redefine this to change how goopt decides whether w is a terminal,
+// which by default is by asking whether it is a character device.
+var IsTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// painting is true while goopt is writing to where it should colour.
+var painting = false
+
+// paintingFor sets painting for output to w, until the function it
+// returns is called.
+func paintingFor(w io.Writer) func() {
+	old := painting
+	switch Color {
+	case ColorAlways:
+		painting = true
+	case ColorNever:
+		painting = false
+	default:
+		painting = os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && IsTerminal(w)
+	}
+	return func() { painting = old }
+}
+
+// paint colours x with the given escape sequence, if painting.
+func paint(style, x string) string {
+	if !painting || style == "" || x == "" {
+		return x
+	}
+	return style + x + "\x1b[0m"
+}
+
+// styleNamed paints x in the style of the Theme field named by kind,
+// e.g. "heading", for use by the help templates.
+func styleNamed(kind, x string) string {
+	switch kind {
+	case "heading":
+		return paint(Colors.Heading, x)
+	case "flag":
+		return paint(Colors.Flag, x)
+	case "arg":
+		return paint(Colors.Arg, x)
+	case "error":
+		return paint(Colors.Error, x)
+	case "warning":
+		return paint(Colors.Warning, x)
+	}
+	return x
+}
+
+// visibleWidth counts the characters of x, leaving out escape
+// sequences such as those of paint.
+func visibleWidth(x string) int {
+	n := 0
+	for len(x) > 0 {
+		if strings.HasPrefix(x, "\x1b[") {
+			if end := strings.IndexByte(x, 'm'); end > 0 {
+				x = x[end+1:]
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(x)
+		x = x[size:]
+		n++
+	}
+	return n
+}
+
+// warn writes a warning to Stderr, after at, which says where the
+// argument that led to it came from.
+func warn(at, msg string) {
+	defer paintingFor(Stderr)()
+	fmt.Fprintf(Stderr, "%s%s %s\n", at, paint(Colors.Warning, "Warning:"), msg)
+}
+
+// setColor handles the argument of --color.
+func setColor(when string) error {
+	switch when {
+	case "", "always":
+		Color = ColorAlways
+	case "never":
+		Color = ColorNever
+	case "auto":
+		Color = ColorAuto
+	default:
+		allowed := []string{"always", "never", "auto"}
+		return &ValueError{when, allowed, suggest(when, allowed)}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package goopt
+
+// Here we read and write configuration files, which hold one option
+// per line in the same form as it would be given on the command line.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mark the named option as secret, so that its value is never written
+// out by WriteConfig or --print-config.  Panics if there is no such
+// option.
+func MarkSecret(name string) {
+	o, ok := lookup(name)
+	if !ok {
+		panic("No such flag: " + name)
+	}
+	o.value.secret = true
+}
+
+// Write every option with its current value to w, in the form read by
+// LoadConfig.  The help for each option is written as a comment, as
+// is the heading of each group, and secret options are left out.
+func WriteConfig(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	experimental := false
+	visitValues(func(o opt) {
+		experimental = experimental || o.experimental && !o.value.secret && !o.isDefault()
+	})
+	if experimental && experimentalAskedFor && len(ExperimentalFlag.Names) > 0 {
+		// the options below would be refused without it
+		fmt.Fprintln(b, "#", Expand(ExperimentalFlag.Help))
+		fmt.Fprintln(b, ExperimentalFlag.Names[0])
+		fmt.Fprintln(b)
+	}
+	group := ""
+	visitValues(func(o opt) {
+		if o.value.secret {
+			return
+		}
+		if o.group != group {
+			group = o.group
+			fmt.Fprintln(b, "##", group)
+			if d := Expand(groupDescriptions[group]); d != "" {
+				for _, l := range strings.Split(d, "\n") {
+					fmt.Fprintln(b, "##", l)
+				}
+			}
+			fmt.Fprintln(b)
+		}
+		for _, l := range strings.Split(Expand(o.help), "\n") {
+			fmt.Fprintln(b, "#", l)
+		}
+		settings := o.reproduce()
+		if len(settings) == 0 {
+			fmt.Fprint(b, "# ", o.canonical())
+			switch {
+			case o.allowsArg != nil && o.value.def != "":
+				fmt.Fprintf(b, "=%s", o.value.def)
+			case o.allowsArg != nil:
+				fmt.Fprintf(b, "=%s", *o.allowsArg)
+			}
+			fmt.Fprintln(b)
+		}
+		for _, words := range settings {
+			for i, word := range words {
+				if i > 0 {
+					fmt.Fprint(b, " ")
+				}
+				fmt.Fprint(b, shellQuote(word))
+			}
+			fmt.Fprintln(b)
+		}
+		fmt.Fprintln(b)
+	})
+	return b.Flush()
+}
+
+// Set options from the named configuration file.  Each line holds
+// one option (e.g. --name=value or --name value), quoted as in sh,
+// and everything from an unquoted # onwards is a comment.  This
+// should be called before Parse, so the command line can override it,
+// and Parse refuses any experimental option set here unless
+// --enable-experimental is given, here or on the command line.
+func LoadConfig(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	lines := bufio.NewScanner(f)
+	for n := 1; lines.Scan(); n++ {
+		words, err := splitWords(lines.Text())
+		if err == nil && len(words) > 0 {
+			err = setFromWords(words, Origin{Kind: FromConfig, File: filename, Line: n})
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", filename, n, err)
+		}
+	}
+	return lines.Err()
+}
+
+// setFromWords sets a single option given as a list of words, such as
+// {"--name=value"}, {"--name", "value"} or {"-nvalue"}.
+func setFromWords(words []string, from Origin) error {
+	name, arg, hasArg := words[0], "", false
+	if x := strings.Index(name, "="); x > 0 && strings.HasPrefix(name, "--") {
+		name, arg, hasArg = name[0:x], name[x+1:], true
+	} else if len(name) > 1 && name[0] == '-' && name[1] != '-' {
+		_, size := utf8.DecodeRuneInString(name[1:])
+		if len(name) > 1+size {
+			name, arg, hasArg = name[0:1+size], name[1+size:], true
+		}
+	}
+	isExperimentalFlag := func(n string) bool { return n == name }
+	if ExperimentalFlag.Enabled && len(words) == 1 && any(isExperimentalFlag, ExperimentalFlag.Names) {
+		// this is a builtin flag, which Parse hasn't added yet
+		allowExperiments()
+		return nil
+	}
+	o, ok := lookup(name)
+	if !ok || o.builtin != nil {
+		return errors.New("unknown option " + name)
+	}
+	rest := words[1:]
+	if !hasArg && o.allowsArg != nil && len(rest) > 0 {
+		arg, hasArg, rest = rest[0], true, rest[1:]
+	}
+	switch {
+	case len(rest) > 0:
+		return errors.New("unexpected " + rest[0] + " after " + name)
+	case hasArg && o.allowsArg == nil:
+		return errors.New(name + " doesn't want an argument")
+	case !hasArg && o.needsArg:
+		return errors.New(name + " requires argument")
+	}
+	o.check(strings.TrimSuffix(from.prefix(), " "), from.prefix(), name)
+	if err := o.set(arg, from); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package goopt
+
+// Here we handle options that are hidden, deprecated or experimental.
+
+import (
+	"errors"
+	"fmt"
+)
+
+// deprecatedNames holds the names given to Deprecate, in order, and
+// deprecated maps each to its replacement.
+var deprecatedNames []string
+
+var deprecated = make(map[string]string)
+
+// Redefine this to true to allow experimental options without the
+// --enable-experimental flag
+var AllowExperimental = false
+
+// experimentalAskedFor is true if AllowExperimental was only set by
+// --enable-experimental, which Serialize then has to give too.
+var experimentalAskedFor = false
+
+// experimentGiven is the name of the first experimental option given,
+// and experimentWhere where it was given, which Parse refuses once it
+// knows whether --enable-experimental was given too.
+var experimentGiven, experimentWhere string
+
+// Hide the named option, so that it still works but is left out of
+// Help(), the man page and --list-options.  Panics if there is no such
+// option.
+func Hide(name string) {
+	mark(name, func(o *opt) { o.hidden = true })
+}
+
+// Deprecate one name of an option, e.g. --colour when --color is to
+// stay.  The name still works but gives a warning naming replacement,
+// if that isn't empty, and it is only shown in the man page, in a
+// section of its own.  Panics if there is no such option.
+func Deprecate(name, replacement string) {
+	mark(name, func(*opt) {})
+	if _, ok := deprecated[name]; !ok {
+		append(&deprecatedNames, name)
+	}
+	deprecated[name] = replacement
+}
+
+// Mark the named option as experimental, so that it may only be used
+// along with --enable-experimental (see ExperimentalFlag) or when
+// AllowExperimental is set.  Panics if there is no such option.
+func Experimental(name string) {
+	mark(name, func(o *opt) { o.experimental = true })
+}
+
+// mark calls f on each option with the given name, and panics if there
+// are none.
+func mark(name string, f func(o *opt)) {
+	found := false
+	for k := range opts {
+		if opts[k].has(name) {
+			f(&opts[k])
+			found = true
+		}
+	}
+	if !found {
+		panic("No such flag: " + name)
+	}
+}
+
+// visible gives this option as it is shown in help, without its
+// deprecated names, or false if it isn't shown at all.
+func (o opt) visible() (opt, bool) {
+	for _, n := range deprecatedNames {
+		if o.has(n) {
+			o.drop(n)
+		}
+	}
+	return o, !o.hidden && (len(o.names) > 0 || len(o.shortnames) > 0)
+}
+
+// check is called whenever an option is given by name on the command
+// line or in a config file, to warn if that name is deprecated, and to note the option if
+// it is experimental, for refuseExperiment.
+func (o opt) check(where, at, name string) {
+	o.warnDeprecated(at, name)
+	if o.experimental && experimentGiven == "" {
+		experimentGiven, experimentWhere = name, where
+	}
+}
+
+// warnDeprecated warns, after at, if name is deprecated.
+func (o opt) warnDeprecated(at, name string) {
+	if replacement, ok := deprecated[name]; ok {
+		if replacement != "" {
+			warn(at, fmt.Sprintf("%s is deprecated; use %s instead", name, replacement))
+		} else {
+			warn(at, name+" is deprecated")
+		}
+	}
+}
+
+// allowExperiments does what --enable-experimental asks for.
+func allowExperiments() {
+	experimentalAskedFor = experimentalAskedFor || !AllowExperimental
+	AllowExperimental = true
+}
+
+// refuseExperiment fails if an experimental option was given, unless
+// that was allowed by the end of the command line.
+func refuseExperiment() {
+	if experimentGiven != "" && !AllowExperimental {
+		failOption(experimentWhere, experimentGiven, experimentError())
+	}
+}
+
+// experimentError says why an experimental option was refused.
+func experimentError() error {
+	how := "not enabled"
+	if ExperimentalFlag.Enabled && len(ExperimentalFlag.Names) > 0 {
+		how = "needs " + ExperimentalFlag.Names[0]
+	}
+	return errors.New("experimental, " + how)
+}
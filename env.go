@@ -0,0 +1,57 @@
+package goopt
+
+// Here we let options be set by environment variables of their own.
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Let the named option be set by the given environment variable (e.g.
+// "MYPROG_NAME"), as though it were given before the command line.
+// An option that takes no argument is set if the variable holds a true
+// value such as 1 or true, and for a Flag a false value sets the other
+// half.  Panics if there is no such option.
+func Env(name, variable string) {
+	mark(name, func(o *opt) { o.env = variable })
+}
+
+// addEnvArgs adds to args the arguments that the variables named by
+// Env stand for, in the form they would take on the command line.
+func addEnvArgs(args *[]string, origins *[]Origin) {
+	for _, o := range opts {
+		v, ok := os.LookupEnv(o.env)
+		if o.env == "" || !ok {
+			continue
+		}
+		from := Origin{Kind: FromEnvironment, Variable: o.env}
+		word := o.canonical()
+		switch {
+		case o.allowsArg != nil && len(o.names) > 0:
+			word += "=" + v
+		case o.needsArg:
+			// the value is a word of its own, even if it is empty
+			append(args, word)
+			appendOrigin(origins, from)
+			word = v
+		case o.allowsArg != nil:
+			word += v
+		default:
+			yes, err := strconv.ParseBool(v)
+			if err != nil {
+				failOption(strings.TrimSuffix(from.prefix(), " "), word,
+					&ValueError{v, []string{"true", "false"}, nil})
+			}
+			switch {
+			case yes:
+			case o.value.no != "" && o.value.yes == word:
+				word = o.value.no
+			default:
+				continue
+			}
+		}
+		append(args, word)
+		appendOrigin(origins, from)
+	}
+}
@@ -7,28 +7,23 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strconv"
 	"strings"
-	"text/tabwriter"
 	"time"
+	"unicode/utf8"
 )
 
 var opts = make([]opt, 0, 8)
 
-// Redefine this function to change the way usage is printed
+// Redefine this function to change the way usage is printed, though
+// changing HelpTemplate may be easier
 var Usage = func() string {
-	programName := os.Args[0][strings.LastIndex(os.Args[0], "/")+1:]
-	usage := fmt.Sprintf("Usage of %s:\n", programName)
-	if Summary != "" {
-		usage += fmt.Sprintf("\t%s", Summary)
-	}
-	usage += fmt.Sprintf("\n%s", Help())
-	if ExtraUsage != "" {
-		usage += fmt.Sprintf("%s\n", ExtraUsage)
-	}
-	return usage
+	d := HelpModel()
+	d.Help = Help()
+	return renderHelp("usage", d)
 }
 
 // Redefine this to change the summary of your program (used in the
@@ -51,10 +46,85 @@ var Version = ""
 // application name) (used in the default manpage())
 var Suite = ""
 
+// Redefine this to true to add the default of each option that takes
+// an argument to its help, e.g. "(default: 80)".  The argument of a
+// String or Int is then labelled with the option's name rather than
+// its default.
+var ShowDefaults = false
+
+// Redefine this to true to add the environment variable that may set
+// an option (see Env) to its help, e.g. "[env: MYPROG_NAME]"
+var ShowEnvVars = false
+
+// Redefine this to true to add the values allowed for an option made
+// by Alternatives to its help, e.g. "(one of: slow, medium, fast)"
+var ShowAllowed = false
+
 // Redefine this to force flags to come before all options or be
-// treated as if they were options
+// treated as if they were options.  This is the same as setting
+// ArgOrder to StopAtArgs.
 var RequireOrder = false
 
+// An Ordering says what to do with arguments that aren't flags.
+type Ordering int
+
+const (
+	// Flags may be mixed with other arguments, which go in Args.
+	Permute Ordering = iota
+	// The first argument that isn't a flag, and everything after it,
+	// goes in Args.  This is what getopt calls REQUIRE_ORDER.
+	StopAtArgs
+	// Each argument that isn't a flag is passed to HandleArg as soon as
+	// it is reached, so it sees the flags before it but not those after.
+	ReturnInOrder
+)
+
+// Redefine this to false to require long flags to be given in full,
+// rather than as any unique prefix (e.g. --verb for --verbose)
+var Abbreviations = true
+
+// Redefine this to change how many characters after the "--" an
+// abbreviated flag must have
+var MinAbbreviation = 1
+
+// Redefine this to true to warn (on stderr) whenever an abbreviated
+// flag is used, since adding a new flag may make it ambiguous
+var WarnAbbreviations = false
+
+// Redefine this to true to treat words that look like negative
+// numbers (e.g. -5 or -3.2e4) as arguments rather than flags, unless
+// a digit is itself used as a short flag
+var NegativeNumbers = false
+
+// Redefine this to change how arguments that aren't flags are handled.
+// If the POSIXLY_CORRECT environment variable is set, Permute is
+// treated as StopAtArgs.
+var ArgOrder = Permute
+
+// Redefine this to handle the arguments that aren't flags when
+// ArgOrder is ReturnInOrder.  Arguments after "--" still go in Args.
+var HandleArg = func(arg string) error {
+	append(&Args, arg)
+	return nil
+}
+
+// Redefine this to true to only give an optional argument to a flag
+// when it is attached, as in --color=auto or -cauto, as getopt_long
+// does.  Otherwise a following word that doesn't look like a flag is
+// taken as the argument.  The optional arguments of the builtin flags
+// such as --help must always be attached.
+var AttachedOptArgs = false
+
+// Redefine this to the name of an environment variable (e.g.
+// "MYPROG_OPTS") holding default arguments, which are split as sh
+// would and placed before those on the command line
+var EnvironmentVariable = ""
+
+// Redefine this to true to replace each @file argument with the
+// arguments held in file, which may be quoted as in sh and may
+// include other response files
+var ResponseFiles = false
+
 // Variables for expansion using Expand(), which is automatically
 // called on help text for flags
 var Vars = make(map[string]string)
@@ -70,46 +140,67 @@ func Expand(x string) string {
 	return x
 }
 
-// Override the way help is displayed (not recommended)
+// Override the way help is displayed (not recommended, see HelpTemplate)
 var Help = func() string {
-	h0 := new(bytes.Buffer)
-	h := tabwriter.NewWriter(h0, 0, 8, 2, ' ', 0)
-	if len(opts) > 1 {
-		fmt.Fprintln(h, "Options:")
+	return renderHelp("help", HelpModel())
+}
+
+// helpText gives the description of an option, with its default,
+// environment variable and allowed values added if asked for.
+func helpText(o opt) string {
+	h := Expand(o.help)
+	if o.experimental {
+		h += " (experimental)"
 	}
-	for _, o := range opts {
-		fmt.Fprint(h, "  ")
+	if ShowDefaults && o.allowsArg != nil && o.value.def != "" && !o.value.multi {
+		h += " (default: " + o.value.def + ")"
+	}
+	if ShowEnvVars && o.env != "" {
+		h += " [env: " + o.env + "]"
+	}
+	if ShowAllowed && len(o.value.allowed) > 0 {
+		h += " (one of: " + strings.Join(o.value.allowed, ", ") + ")"
+	}
+	return h
+}
+
+// helpLabel gives the names of an option as Help() shows them.
+func helpLabel(o opt) string {
+	h := new(bytes.Buffer)
+	if len(o.shortnames) > 0 {
+		for _, sn := range o.shorts()[0 : len(o.shorts())-1] {
+			fmt.Fprintf(h, "%s, ", paint(Colors.Flag, "-"+string(sn)))
+		}
+		fmt.Fprint(h, paint(Colors.Flag, "-"+string(o.shorts()[len(o.shorts())-1])))
+		if len(o.names) == 0 {
+			fmt.Fprint(h, paint(Colors.Arg, o.argLabel(false, " ")))
+		}
+	}
+	if len(o.names) > 0 {
 		if len(o.shortnames) > 0 {
-			for _, sn := range o.shortnames[0 : len(o.shortnames)-1] {
-				fmt.Fprintf(h, "-%c, ", sn)
-			}
-			fmt.Fprintf(h, "-%c", o.shortnames[len(o.shortnames)-1])
-			if o.allowsArg != nil && len(o.names) == 0 {
-				fmt.Fprintf(h, " %s", *o.allowsArg)
-			}
+			fmt.Fprint(h, ", ")
 		}
-		if len(o.names) > 0 {
-			if len(o.shortnames) > 0 {
-				fmt.Fprint(h, ", ")
-			}
-			for _, n := range o.names[0 : len(o.names)-1] {
-				fmt.Fprintf(h, "%s, ", n)
-			}
-			fmt.Fprint(h, o.names[len(o.names)-1])
-			if o.allowsArg != nil {
-				fmt.Fprintf(h, "=%s", *o.allowsArg)
-			}
+		for _, n := range o.names[0 : len(o.names)-1] {
+			fmt.Fprintf(h, "%s, ", paint(Colors.Flag, n))
 		}
-		fmt.Fprintf(h, "\t%v\n", Expand(o.help))
+		fmt.Fprint(h, paint(Colors.Flag, o.names[len(o.names)-1]))
+		fmt.Fprint(h, paint(Colors.Arg, o.argLabel(true, "=")))
 	}
-	h.Flush()
-	return h0.String()
+	return h.String()
+}
+
+func programName() string {
+	return os.Args[0][strings.LastIndex(os.Args[0], "/")+1:]
 }
 
 // Override the shortened help for your program (not recommended)
 var Synopsis = func() string {
 	h := new(bytes.Buffer)
 	for _, o := range opts {
+		o, ok := o.visible()
+		if !ok {
+			continue
+		}
 		fmt.Fprint(h, " [")
 		switch {
 		case len(o.shortnames) == 0:
@@ -117,17 +208,13 @@ var Synopsis = func() string {
 				fmt.Fprintf(h, "\\-\\-%s|", n[2:])
 			}
 			fmt.Fprintf(h, "\\-\\-%s", o.names[len(o.names)-1][2:])
-			if o.allowsArg != nil {
-				fmt.Fprintf(h, " %s", *o.allowsArg)
-			}
+			fmt.Fprint(h, o.argLabel(true, " "))
 		case len(o.names) == 0:
-			for _, c := range o.shortnames[0 : len(o.shortnames)-1] {
+			for _, c := range o.shorts()[0 : len(o.shorts())-1] {
 				fmt.Fprintf(h, "\\-%c|", c)
 			}
-			fmt.Fprintf(h, "\\-%c", o.shortnames[len(o.shortnames)-1])
-			if o.allowsArg != nil {
-				fmt.Fprintf(h, " %s", *o.allowsArg)
-			}
+			fmt.Fprintf(h, "\\-%c", o.shorts()[len(o.shorts())-1])
+			fmt.Fprint(h, o.argLabel(false, " "))
 		default:
 			for _, c := range o.shortnames {
 				fmt.Fprintf(h, "\\-%c|", c)
@@ -136,9 +223,7 @@ var Synopsis = func() string {
 				fmt.Fprintf(h, "\\-\\-%s|", n[2:])
 			}
 			fmt.Fprintf(h, "\\-\\-%s", o.names[len(o.names)-1][2:])
-			if o.allowsArg != nil {
-				fmt.Fprintf(h, " %s", *o.allowsArg)
-			}
+			fmt.Fprint(h, o.argLabel(true, " "))
 		}
 		fmt.Fprint(h, "]")
 	}
@@ -159,25 +244,153 @@ type opt struct {
 	needsArg         bool
 	allowsArg        *string            // nil means we don't allow an argument
 	process          func(string) error // returns error when it's illegal
+	value            *value             // shared by the yes and no halves of a Flag
+	builtin          *Builtin           // set for --help and friends
+	hidden           bool               // true to leave out of Help() and the man page
+	exact            bool               // true if the long names may not be abbreviated
+	group            string             // the heading to show this option under, if any
+	experimental     bool               // true if this may only be used when asked for
+	level            Level              // how advanced this is, to say when Help() shows it
+	env              string             // the environment variable that sets this, if any
+	defLabel         bool               // true if the argument's label is only its default
+	attached         bool               // true if an optional argument must be attached
+}
+
+// A value holds what we know about the setting of an option, apart
+// from whatever the process function does with it.
+type value struct {
+	def     string          // the default, as it would be given on the command line
+	get     func() []string // the current setting, nil if only process knows it
+	multi   bool            // true if the option accumulates, as with Strings
+	yes     string          // for a Flag, the name that sets it to true
+	no      string          // for a Flag, the name that sets it to false
+	allowed []string        // the only arguments accepted, if limited
+	secret  bool            // true if the value must not be written out
+	seen    []string        // every argument successfully processed
+	origin  Origin
+}
+
+// current returns the setting of an option in command-line form.
+func (o opt) current() []string {
+	switch {
+	case o.value.get != nil:
+		return o.value.get()
+	case o.allowsArg == nil:
+		return []string{strconv.FormatBool(len(o.value.seen) > 0)}
+	}
+	return o.value.seen
+}
+
+// reproduce returns the arguments that would give this option its
+// current setting, using canonical names, one group of words for each
+// time the option would be given.
+func (o opt) reproduce() [][]string {
+	switch {
+	case o.builtin != nil:
+		return nil
+	case o.value.yes != "" || o.value.no != "":
+		name := o.value.no
+		if o.current()[0] == "true" {
+			name = o.value.yes
+		}
+		if name == "" {
+			return nil
+		}
+		return [][]string{{name}}
+	case o.allowsArg == nil:
+		out := make([][]string, len(o.value.seen))
+		for i := range out {
+			out[i] = []string{o.canonical()}
+		}
+		return out
+	}
+	vs := o.current()
+	out := make([][]string, len(vs))
+	for i, v := range vs {
+		switch {
+		case len(o.names) > 0:
+			out[i] = []string{o.canonical() + "=" + v}
+		case !o.needsArg:
+			// an optional argument must be attached, as in -cauto
+			out[i] = []string{o.canonical() + v}
+		default:
+			out[i] = []string{o.canonical(), v}
+		}
+	}
+	return out
+}
+
+// shorts returns the short names of this option.
+func (o opt) shorts() []rune {
+	return []rune(o.shortnames)
+}
+
+// argLabel describes the argument this option takes, to follow its
+// name, with sep between them.  An optional argument must be attached
+// to the name, so it is shown as e.g. --color[=WHEN] or -c[WHEN].
+func (o opt) argLabel(long bool, sep string) string {
+	switch {
+	case o.allowsArg == nil:
+		return ""
+	case o.needsArg:
+		return sep + o.label()
+	case long:
+		return "[=" + o.label() + "]"
+	}
+	return "[" + o.label() + "]"
+}
+
+// label gives the name of this option's argument.  Where that is only
+// the default, and ShowDefaults puts the default in the description
+// instead, the option's name in capitals is used, e.g. NAME for --name.
+func (o opt) label() string {
+	switch {
+	case !ShowDefaults || !o.defLabel:
+		return *o.allowsArg
+	case len(o.names) > 0:
+		return strings.ToUpper(strings.TrimLeft(o.names[0], "-"))
+	}
+	return "VALUE"
+}
+
+// set processes an argument for this option, recording where it came
+// from if it is accepted.
+func (o opt) set(arg string, from Origin) error {
+	if err := o.process(arg); err != nil {
+		return err
+	}
+	append(&o.value.seen, arg)
+	o.value.origin = from
+	return nil
 }
 
 func addOpt(o opt) {
 	newnames := make([]string, 0, len(o.names))
 	for _, n := range o.names {
 		switch {
+		case !utf8.ValidString(n):
+			panic("Invalid flag, not UTF-8: " + n)
 		case len(n) < 2:
 			panic("Invalid very short flag: " + n)
 		case n[0] != '-':
 			panic("Invalid flag, doesn't start with '-':" + n)
-		case len(n) == 2:
-			o.shortnames = o.shortnames + string(n[1])
+		case n[1] != '-' && utf8.RuneCountInString(n) == 2:
+			o.shortnames = o.shortnames + n[1:]
 		case n[1] != '-':
 			panic("Invalid long flag, doesn't start with '--':" + n)
+		case len(n) == 2:
+			panic("Invalid flag, '--' means no more flags")
 		default:
 			append(&newnames, n)
 		}
 	}
 	o.names = newnames
+	if o.value == nil {
+		o.value = new(value)
+	}
+	if !claimNames(&o) {
+		return // this was a builtin whose names were all taken
+	}
 	if len(opts) == cap(opts) { // reallocate
 		// Allocate double what's needed, for future growth.
 		newOpts := make([]opt, len(opts), len(opts)*2)
@@ -190,9 +403,132 @@ func addOpt(o opt) {
 	opts[len(opts)-1] = o
 }
 
+// claimNames resolves clashes between the names of a new option and
+// those of the options we already have, according to OnConflict.  It
+// returns false if the new option is left without any names.
+func claimNames(o *opt) bool {
+	for _, n := range o.allNames() {
+		for k := range opts {
+			if !opts[k].has(n) {
+				continue
+			}
+			switch {
+			case OnConflict == ShadowBuiltins && opts[k].builtin != nil && o.builtin == nil:
+				opts[k].drop(n)
+			case OnConflict == ShadowBuiltins && o.builtin != nil && opts[k].builtin == nil:
+				o.drop(n)
+			case o.builtin != nil && opts[k].builtin != nil:
+				o.drop(n) // the first builtin keeps it
+			case OnConflict == ErrorOnConflict:
+				append(&conflicts, n)
+				o.drop(n)
+			default:
+				panic("Flag defined twice: " + n)
+			}
+		}
+	}
+	// Drop any builtins that have lost all of their names.
+	kept := opts[0:0]
+	for _, oo := range opts {
+		if len(oo.names) > 0 || len(oo.shortnames) > 0 {
+			kept = kept[0 : len(kept)+1]
+			kept[len(kept)-1] = oo
+		}
+	}
+	opts = kept
+	return len(o.names) > 0 || len(o.shortnames) > 0
+}
+
+// A ConflictPolicy says what to do when two options share a name.
+type ConflictPolicy int
+
+const (
+	// Options defined by the program take names away from builtins
+	// such as --help, which lose them in Help() too.  Two options
+	// defined by the program may not share a name.
+	ShadowBuiltins ConflictPolicy = iota
+	// Any name that is used twice causes a panic.
+	PanicOnConflict
+	// Any name that is used twice makes Parse fail.  The first option
+	// to claim the name keeps it.
+	ErrorOnConflict
+)
+
+// Redefine this to change what happens when two options share a name.
+// It must be set before the options are defined.
+var OnConflict = ShadowBuiltins
+
+// The names that were used twice, under ErrorOnConflict.
+var conflicts = make([]string, 0)
+
+// allNames returns all the names of an option, e.g. "-v", "--verbose".
+func (o opt) allNames() []string {
+	out := make([]string, 0, len(o.names)+len(o.shortnames))
+	for _, n := range o.names {
+		append(&out, n)
+	}
+	for _, c := range o.shortnames {
+		append(&out, "-"+string(c))
+	}
+	return out
+}
+
+// has returns true if name (e.g. "-v" or "--verbose") is one of the
+// names of this option.
+func (o opt) has(name string) bool {
+	if utf8.RuneCountInString(name) == 2 && name[0] == '-' && name[1] != '-' {
+		return strings.Contains(o.shortnames, name[1:])
+	}
+	for _, n := range o.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// drop removes a name from this option.
+func (o *opt) drop(name string) {
+	if len(name) > 1 && name[1] != '-' {
+		o.shortnames = strings.Replace(o.shortnames, name[1:], "", 1)
+		return
+	}
+	kept := make([]string, 0, len(o.names))
+	for _, n := range o.names {
+		if n != name {
+			append(&kept, n)
+		}
+	}
+	o.names = kept
+}
+
+// Require the named option to be given in full on the command line,
+// even when abbreviations are allowed.  This is wise for dangerous
+// flags such as --delete-all.  Panics if there is no such option.
+func NoAbbreviation(name string) {
+	mark(name, func(o *opt) { o.exact = true })
+}
+
+// Set the label of the named option's argument in help, e.g. FILE in
+// --output=FILE, whichever way the option was made.  Panics if there
+// is no such option, or if it takes no argument.
+func Label(name, label string) {
+	mark(name, func(o *opt) {
+		if o.allowsArg == nil {
+			panic("No such flag with an argument: " + name)
+		}
+		o.allowsArg = &label
+		o.defLabel = false
+	})
+}
+
 // Execute the given closure on the name of all known arguments
 func VisitAllNames(f func(string)) {
 	for _, o := range opts {
+		o, ok := o.visible()
+		if !ok {
+			continue
+		}
 		for _, n := range o.names {
 			f(n)
 		}
@@ -205,12 +541,17 @@ func VisitAllNames(f func(string)) {
 //   help    string            The help text (automatically Expand()ed) to display for this flag
 //   process func() os.Error   The function to call when this flag is processed with no argument
 func NoArg(names []string, help string, process func() error) {
-	addOpt(opt{names, "", help, false, nil, func(s string) error {
-		if s != "" {
-			return errors.New("unexpected flag: " + s)
-		}
-		return process()
-	}})
+	noArg(names, help, process, new(value))
+}
+
+func noArg(names []string, help string, process func() error, v *value) {
+	addOpt(opt{names: names, help: help, value: v,
+		process: func(s string) error {
+			if s != "" {
+				return errors.New("unexpected flag: " + s)
+			}
+			return process()
+		}})
 }
 
 // Add a new flag that requires an argument
@@ -220,22 +561,40 @@ func NoArg(names []string, help string, process func() error) {
 //   help    string                  The help text (automatically Expand()ed) to display for this flag
 //   process func(string) os.Error   The function to call when this flag is processed
 func ReqArg(names []string, argname, help string, process func(string) error) {
-	addOpt(opt{names, "", help, true, &argname, process})
+	reqArg(names, argname, help, process, new(value))
+}
+
+func reqArg(names []string, argname, help string, process func(string) error, v *value) {
+	addOpt(opt{names: names, help: help, needsArg: true, allowsArg: &argname,
+		process: process, value: v})
 }
 
 // Add a new flag that may optionally have an argument
 // Parameters:
 //   names []string                 These are the names that are accepted on the command-line for this flag, e.g. -v --verbose
-//   def     string                 The default of the argument in help, e.g. the "value" part of "--flag=value"
+//   def     string                 The argument when none is given, and its label in Help()
 //   help    string                 The help text (automatically Expand()ed) to display for this flag
 //   process func(string) os.Error  The function to call when this flag is processed with an argument
 func OptArg(names []string, def, help string, process func(string) error) {
-	addOpt(opt{names, "", help, false, &def, func(s string) error {
-		if s == "" {
-			return process(def)
-		}
-		return process(s)
-	}})
+	OptArgWithLabel(names, def, def, help, process)
+	opts[len(opts)-1].defLabel = true
+}
+
+// Add a new flag that may optionally have an argument, with a Help() label
+// Parameters:
+//   names []string                 These are the names that are accepted on the command-line for this flag, e.g. -v --verbose
+//   def     string                 The argument when none is given
+//   label   string                 Label for display in Help(), e.g. the "WHEN" part of "--color[=WHEN]"
+//   help    string                 The help text (automatically Expand()ed) to display for this flag
+//   process func(string) os.Error  The function to call when this flag is processed with an argument
+func OptArgWithLabel(names []string, def, label, help string, process func(string) error) {
+	addOpt(opt{names: names, help: help, allowsArg: &label,
+		process: func(s string) error {
+			if s == "" {
+				return process(def)
+			}
+			return process(s)
+		}, value: &value{def: def}})
 }
 
 // Create a required-argument flag that only accepts the given set of values
@@ -272,9 +631,10 @@ func AlternativesWithLabel(names, vs []string, label string, help string) *strin
 				return nil
 			}
 		}
-		return errors.New("invalid value: " + s)
+		return &ValueError{s, vs, suggest(s, vs)}
 	}
-	ReqArg(names, label, help, f)
+	reqArg(names, label, help, f, &value{def: vs[0], allowed: vs,
+		get: func() []string { return []string{*out} }})
 	return out
 }
 
@@ -286,7 +646,9 @@ func AlternativesWithLabel(names, vs []string, label string, help string) *strin
 // Returns:
 //   *string                   This points to a string whose value is updated as this flag is changed
 func String(names []string, def string, help string) *string {
-	return StringWithLabel(names, def, def, help)
+	s := StringWithLabel(names, def, def, help)
+	opts[len(opts)-1].defLabel = true
+	return s
 }
 
 // Create a required-argument flag that accepts string values and has a Help() label
@@ -304,7 +666,8 @@ func StringWithLabel(names []string, def string, label string, help string) *str
 		*s = ss
 		return nil
 	}
-	ReqArg(names, label, help, f)
+	reqArg(names, label, help, f, &value{def: def,
+		get: func() []string { return []string{*s} }})
 	return s
 }
 
@@ -316,7 +679,9 @@ func StringWithLabel(names []string, def string, label string, help string) *str
 // Returns:
 //   *int                      This points to an int whose value is updated as this flag is changed
 func Int(names []string, def int, help string) *int {
-	return IntWithLabel(names, def, strconv.Itoa(def), help)
+	i := IntWithLabel(names, def, strconv.Itoa(def), help)
+	opts[len(opts)-1].defLabel = true
+	return i
 }
 
 // Create a required-argument flag that accepts int values and has a Help() label
@@ -335,7 +700,8 @@ func IntWithLabel(names []string, def int, label string, help string) *int {
 		*i, err = strconv.Atoi(istr)
 		return err
 	}
-	ReqArg(names, label, help, f)
+	reqArg(names, label, help, f, &value{def: strconv.Itoa(def),
+		get: func() []string { return []string{strconv.Itoa(*i)} }})
 	return i
 }
 
@@ -352,7 +718,8 @@ func Strings(names []string, def string, help string) *[]string {
 		append(&s, ss)
 		return nil
 	}
-	ReqArg(names, def, help, f)
+	reqArg(names, def, help, f, &value{multi: true,
+		get: func() []string { return s }})
 	return &s
 }
 
@@ -378,107 +745,303 @@ func Flag(yes []string, no []string, helpyes, helpno string) *bool {
 		*b = false
 		return nil
 	}
+	v := &value{def: "false",
+		get: func() []string { return []string{strconv.FormatBool(*b)} }}
 	if len(yes) > 0 {
-		NoArg(yes, helpyes, y)
+		noArg(yes, helpyes, y, v)
+		v.yes = opts[len(opts)-1].canonical()
 	}
 	if len(no) > 0 {
-		NoArg(no, helpno, n)
+		noArg(no, helpno, n, v)
+		v.no = opts[len(opts)-1].canonical()
 	}
 	return b
 }
 
 func failnoting(s string, e error) {
 	if e != nil {
-		fmt.Println(Usage())
-		fmt.Println("\n"+s, e.Error())
-		os.Exit(1)
+		if s != "" {
+			e = fmt.Errorf("%s %w", s, e)
+		}
+		OnError(e)
+		if parsing {
+			panic(exiting{})
+		}
+	}
+}
+
+// failOption reports an error in processing the given flag, if there
+// is one.
+func failOption(where, flag string, err error) {
+	if err != nil {
+		failnoting(where, &OptionError{flag, err})
+	}
+}
+
+// Redefine this to change what happens when the command line can't be
+// parsed.  A flag that is unknown or ambiguous gives a *FlagError, and
+// a bad argument to a flag gives an *OptionError, which errors.As will
+// find.  The default writes the error to Stderr, followed by a hint to
+// use --help, and exits.  If it returns, Parse returns at once.
+var OnError = func(err error) {
+	defer paintingFor(Stderr)()
+	if FullUsageOnError {
+		fmt.Fprintln(Stderr, Usage())
+	}
+	fmt.Fprintf(Stderr, "%s %v\n", paint(Colors.Error, programName()+":"), err)
+	var bad *OptionError
+	if HelpOnError && errors.As(err, &bad) {
+		if o, ok := lookup(bad.Flag); ok {
+			if o, ok := o.visible(); ok {
+				g := HelpGroup{Options: []HelpOption{helpOption(o)}}
+				g.Column, g.TextWidth = helpColumns(visibleWidth(helpLabel(o)) + 2)
+				fmt.Fprint(Stderr, renderHelp("options", g))
+			}
+		}
+	}
+	if !FullUsageOnError && HelpFlag.Enabled && len(HelpFlag.Names) > 0 {
+		fmt.Fprintf(Stderr, "Try '%s %s' for more information.\n",
+			programName(), HelpFlag.Names[0])
+	}
+	exit(1)
+}
+
+// Redefine this to change where normal output, such as that of
+// --help, is written
+var Stdout io.Writer = os.Stdout
+
+// Redefine this to change where errors and warnings are written
+var Stderr io.Writer = os.Stderr
+
+// Redefine this to change what happens when Parse is finished with the
+// program, after --help or an error for instance.  If it returns,
+// Parse returns at once rather than carrying on.
+var Exit = os.Exit
+
+// exiting is what exit panics with, to get back out of Parse.
+type exiting struct{}
+
+// parsing is true while Parse is running, and so may be got out of by
+// panicking with exiting.
+var parsing = false
+
+// exit calls Exit, and if that returns and Parse is running, gets
+// back out of it.  Otherwise, as when OnError is called by the
+// program, it simply returns.
+func exit(code int) {
+	Exit(code)
+	if parsing {
+		panic(exiting{})
+	}
+}
+
+// Redefine this to true to print the whole of Usage() before an error
+// on the command line, rather than a hint to use --help
+var FullUsageOnError = false
+
+// Redefine this to true to print the help for a flag after an error
+// in its argument
+var HelpOnError = false
+
+// An OptionError is a problem with the argument (or lack of one) given
+// to a flag.
+type OptionError struct {
+	Flag string // the flag, e.g. "--speed"
+	Err  error
+}
+
+func (e *OptionError) Error() string {
+	return "Error in flag " + e.Flag + ": " + e.Err.Error()
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// A FlagError is a flag that isn't known, or that is an abbreviation
+// of more than one flag.
+type FlagError struct {
+	Flag        string   // the flag as given, e.g. "--h"
+	Candidates  []string // the flags it could mean, if it is ambiguous
+	Suggestions []string // the flags it might be a misspelling of
+}
+
+func (e *FlagError) Error() string {
+	if len(e.Candidates) > 0 {
+		return e.Flag + " is ambiguous: " + strings.Join(e.Candidates, ", ")
+	}
+	return "Bad flag: " + e.Flag + didYouMean(e.Suggestions)
+}
+
+// A ValueError is an argument to a flag that isn't one of the values
+// it allows, as with Alternatives.
+type ValueError struct {
+	Value       string   // the value as given
+	Allowed     []string // the values that are allowed
+	Suggestions []string // the allowed values it might be a misspelling of
+}
+
+func (e *ValueError) Error() string {
+	return "invalid value: " + e.Value + didYouMean(e.Suggestions)
+}
+
+func didYouMean(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
 	}
+	return " (did you mean " + strings.Join(suggestions, " or ") + "?)"
 }
 
 // This is the list of non-flag arguments after processing
 var Args = make([]string, 0, 4)
 
 // This parses the command-line arguments. It returns true if '--' was present.
+// If EnvironmentVariable is set, the arguments it holds come first.
+// If ResponseFiles is true, any @file arguments are first replaced by
+// the arguments held in file.
 // Special flags are:
 //   --help               Display the generated help message (calls Help())
 //   --create-manpage     Display a manpage generated by the goopt library (uses Author, Suite, etc)
 //   --list-options       List all known flags
+//   --print-config       Print each option's value and origin (if PrintConfigFlag is Enabled)
+//   --write-config       Write the options to a config file (if WriteConfigFlag is Enabled)
+// These are described by HelpFlag, VersionFlag and so on, which can be
+// changed before calling Parse.
 // Arguments:
 //   extraopts func() []string     This function is called by --list-options and returns extra options to display
-func Parse(extraopts func() []string) bool {
-	// First we'll add the "--help" option.
-	addOpt(opt{[]string{"--help", "-h"}, "", "Show usage message", false, nil,
-		func(string) error {
-			fmt.Println(Usage())
-			os.Exit(0)
-			return nil
-		}})
-	addOpt(opt{[]string{"--version"}, "", "Show version", false, nil,
-		func(string) error {
-			fmt.Println(Version)
-			os.Exit(0)
-			return nil
-		}})
+func Parse(extraopts func() []string) (earlyEnd bool) {
+	defer func(was bool) {
+		parsing = was
+		if r := recover(); r != nil {
+			if _, ok := r.(exiting); !ok {
+				panic(r)
+			}
+		}
+	}(parsing)
+	parsing = true
+	extraOptions = extraopts
+	addBuiltins()
+	if len(conflicts) > 0 {
+		failnoting("Flags defined twice:", errors.New(strings.Join(conflicts, " ")))
+	}
+	args := make([]string, 1, len(os.Args))
+	origins := make([]Origin, 1, len(os.Args))
+	args[0], origins[0] = os.Args[0], commandLine(0)
+	addEnvArgs(&args, &origins)
+	literal := len(args) // the values of Env variables are never response files
+	if EnvironmentVariable != "" {
+		words, err := splitWords(os.Getenv(EnvironmentVariable))
+		failnoting("Error in $"+EnvironmentVariable+":", err)
+		for _, w := range words {
+			append(&args, w)
+			appendOrigin(&origins, Origin{Kind: FromEnvironment, Variable: EnvironmentVariable})
+		}
+	}
+	for i, a := range os.Args[1:] {
+		append(&args, a)
+		appendOrigin(&origins, commandLine(i+1))
+	}
+	if ResponseFiles {
+		var err error
+		args, origins, err = expandResponseFiles(args, origins, literal)
+		failnoting("Error in response file:", err)
+	}
 	// Let's now tally all the long option names, so we can use this to
 	// find "unique" options.
-	longnames := []string{"--list-options", "--create-manpage"}
+	longnames, abbreviable, shown := []string{}, []string{}, []string{}
 	for _, o := range opts {
 		longnames = cat(longnames, o.names)
+		if !o.exact {
+			abbreviable = cat(abbreviable, o.names)
+		}
+		if o, ok := o.visible(); ok {
+			shown = cat(shown, o.names)
+		}
 	}
-	// Now let's check if --list-options was given, and if so, list all
-	// possible options.
-	if any(func(a string) bool { return match(a, longnames) == "--list-options" },
-		os.Args[1:]) {
-		if extraopts != nil {
-			for _, o := range extraopts() {
-				fmt.Println(o)
+	// Now let's check if --list-options or --create-manpage was given
+	// anywhere, even after a bad flag, and if so, handle it at once.
+	// Likewise --color=WHEN applies to any help or error they lead to.
+	for _, o := range opts {
+		given := any(func(a string) bool {
+			f, _ := match(a, longnames, abbreviable)
+			return o.has(f)
+		}, args[1:])
+		switch {
+		case !given:
+		case o.builtin == ListOptionsFlag || o.builtin == CreateManpageFlag:
+			failnoting("Error in flag "+o.canonical()+":", o.process(""))
+		case o.builtin == ColorFlag:
+			for _, a := range args[1:] {
+				if f, _ := match(a, longnames, abbreviable); o.has(f) && strings.Contains(a, "=") {
+					o.process(a[strings.Index(a, "=")+1:]) // any error is reported later
+				}
 			}
 		}
-		VisitAllNames(func(n string) { fmt.Println(n) })
-		os.Exit(0)
 	}
-	// Now let's check if --create-manpage was given, and if so, create a
-	// man page.
-	if any(func(a string) bool { return match(a, longnames) == "--create-manpage" },
-		os.Args[0:]) {
-		makeManpage()
-		os.Exit(0)
+	// Negative numbers can only be arguments if they can't be flags.
+	isNumber := func(string) bool { return false }
+	if NegativeNumbers {
+		isNumber = looksNumeric
+		for _, o := range opts {
+			if strings.ContainsAny(o.shortnames, "0123456789.") {
+				isNumber = func(string) bool { return false }
+			}
+		}
+	}
+	order := ArgOrder
+	if RequireOrder || order == Permute && os.Getenv("POSIXLY_CORRECT") != "" {
+		order = StopAtArgs
 	}
 	skip := 1
-	earlyEnd := false
-	for i, a := range os.Args {
+	for i, a := range args {
 		if skip > 0 {
 			skip--
 			continue
 		}
+		at := origins[i].prefix() // where to say a bad argument came from
+		where := strings.TrimSuffix(at, " ")
 		if a == "--" {
-			Args = cat(Args, os.Args[i+1:])
+			Args = cat(Args, args[i+1:])
 			earlyEnd = true
 			break
 		}
-		if len(a) > 1 && a[0] == '-' && a[1] != '-' {
+		if len(a) > 1 && a[0] == '-' && a[1] != '-' && !isNumber(a) {
+		cluster:
 			for j, s := range a[1:] {
 				foundone := false
 				for _, o := range opts {
 					for _, c := range o.shortnames {
 						if c == s {
+							o.check(where, at, "-"+string(c))
+							_, size := utf8.DecodeRuneInString(a[1+j:])
+							rest := a[1+j+size:]
 							switch {
-							case o.allowsArg != nil &&
+							case o.allowsArg != nil && rest != "":
+								// the rest of the word is the argument, as in -ofile
+								failOption(where, "-"+string(c),
+									o.set(rest, origins[i]))
+								break cluster
+							case o.needsArg && len(args) > i+skip+1:
+								// a required argument is the next word, whatever it looks like
+								failOption(where, "-"+string(c),
+									o.set(args[i+skip+1], origins[i]))
+								skip++
+							case o.allowsArg != nil && !AttachedOptArgs && !o.attached &&
 								//	j+1 == len(a)-1 &&
-								len(os.Args) > i+skip+1 &&
-								len(os.Args[i+skip+1]) >= 1 &&
-								(os.Args[i+skip+1] == "-" ||
-									os.Args[i+skip+1][0] != '-'):
+								len(args) > i+skip+1 &&
+								len(args[i+skip+1]) >= 1 &&
+								(args[i+skip+1] == "-" ||
+									args[i+skip+1][0] != '-' ||
+									isNumber(args[i+skip+1])):
 								// this last one prevents options from taking options as arguments...
-								failnoting("Error in flag -"+string(c)+":",
-									o.process(os.Args[i+skip+1]))
+								failOption(where, "-"+string(c),
+									o.set(args[i+skip+1], origins[i]))
 								skip++ // skip next arg in looking for flags...
 							case o.needsArg:
-								fmt.Printf("Flag -%c requires argument!\n", c)
-								os.Exit(1)
+								failOption(where, "-"+string(c), errors.New("requires an argument"))
 							default:
-								failnoting("Error in flag -"+string(c)+":",
-									o.process(""))
+								failOption(where, "-"+string(c),
+									o.set("", origins[i]))
 							}
 							foundone = true
 							break
@@ -486,39 +1049,48 @@ func Parse(extraopts func() []string) bool {
 					} // Loop over the shortnames that this option supports
 				} // Loop over the short arguments that we know
 				if !foundone {
-					badflag := "-" + a[j+1:j+2]
-					failnoting("Bad flag:", errors.New(badflag))
+					badflag := "-" + string(s)
+					failnoting(where, &FlagError{Flag: badflag})
 				}
 			} // Loop over the characters in this short argument
 		} else if len(a) > 2 && a[0] == '-' && a[1] == '-' {
 			// Looking for a long flag.  Any unique prefix is accepted!
-			aflag := match(os.Args[i], longnames)
+			given := strings.SplitN(a, "=", 2)[0]
+			aflag, candidates := match(given, longnames, abbreviable)
 			foundone := false
 			if aflag == "" {
-				failnoting("Bad flag:", errors.New(a))
+				failnoting(where, &FlagError{Flag: given,
+					Candidates: candidates, Suggestions: suggest(given, shown)})
+			}
+			if WarnAbbreviations && given != aflag {
+				warn(at, given+" is short for "+aflag+", which may change")
 			}
 		optloop:
 			for _, o := range opts {
 				for _, n := range o.names {
 					if aflag == n {
+						o.check(where, at, n)
 						if x := strings.Index(a, "="); x > 0 {
 							// We have a --flag=foo argument
 							if o.allowsArg == nil {
-								fmt.Println("Flag", a, "doesn't want an argument!")
-								os.Exit(1)
+								failOption(where, aflag, errors.New("doesn't want an argument"))
 							}
-							failnoting("Error in flag "+a+":",
-								o.process(a[x+1:len(a)]))
-						} else if o.allowsArg != nil && len(os.Args) > i+1 && len(os.Args[i+1]) >= 1 && (os.Args[i+1] == "-" || os.Args[i+1][0] != '-') {
+							failOption(where, aflag,
+								o.set(a[x+1:len(a)], origins[i]))
+						} else if o.needsArg && len(args) > i+1 {
+							// a required argument is the next word, whatever it looks like
+							failOption(where, n,
+								o.set(args[i+1], origins[i]))
+							skip++
+						} else if o.allowsArg != nil && !AttachedOptArgs && !o.attached && len(args) > i+1 && len(args[i+1]) >= 1 && (args[i+1] == "-" || args[i+1][0] != '-' || isNumber(args[i+1])) {
 							// last check sees if the next arg looks like a flag
-							failnoting("Error in flag "+n+":",
-								o.process(os.Args[i+1]))
+							failOption(where, n,
+								o.set(args[i+1], origins[i]))
 							skip++ // skip next arg in looking for flags...
 						} else if o.needsArg {
-							fmt.Println("Flag", a, "requires argument!")
-							os.Exit(1)
+							failOption(where, n, errors.New("requires an argument"))
 						} else { // no (optional) argument was provided...
-							failnoting("Error in flag "+n+":", o.process(""))
+							failOption(where, n, o.set("", origins[i]))
 						}
 						foundone = true
 						break optloop
@@ -526,40 +1098,60 @@ func Parse(extraopts func() []string) bool {
 				}
 			}
 			if !foundone {
-				failnoting("Bad flag:", errors.New(a))
+				failnoting(where, &FlagError{Flag: given})
 			}
 		} else {
-			if RequireOrder {
-				Args = cat(Args, os.Args[i:])
+			if order == StopAtArgs {
+				Args = cat(Args, args[i:])
 				break
 			}
-			append(&Args, a)
+			if order == ReturnInOrder {
+				failnoting(at+"Error in argument "+a+":", HandleArg(a))
+			} else {
+				append(&Args, a)
+			}
 		}
 	}
-
+	refuseExperiment()
+	finishBuiltins()
 	return earlyEnd
 }
 
-func match(x string, allflags []string) string {
+// looksNumeric returns true if x is a negative number such as -5 or
+// -3.2e4 (but not -inf, which could well be a cluster of flags).
+func looksNumeric(x string) bool {
+	if len(x) < 2 || x[0] != '-' || !strings.ContainsRune("0123456789.", rune(x[1])) {
+		return false
+	}
+	_, err := strconv.ParseFloat(x, 64)
+	return err == nil
+}
+
+// match finds the long flag named by x, which may be a unique prefix
+// of one of the abbreviable flags.  If there is no such flag, it
+// returns "" along with all the flags that x could be short for.
+func match(x string, allflags, abbreviable []string) (string, []string) {
 	if i := strings.Index(x, "="); i > 0 {
 		x = x[0:i]
 	}
 	for _, f := range allflags {
 		if f == x {
-			return x
+			return x, nil
 		}
 	}
-	out := ""
-	for _, f := range allflags {
+	if !Abbreviations || len(x) < 2+MinAbbreviation {
+		return "", nil
+	}
+	candidates := []string{}
+	for _, f := range abbreviable {
 		if len(f) >= len(x) && f[0:len(x)] == x {
-			if out == "" {
-				out = f
-			} else {
-				return ""
-			}
+			append(&candidates, f)
 		}
 	}
-	return out
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	return "", candidates
 }
 
 func makeManpage() {
@@ -568,59 +1160,91 @@ func makeManpage() {
 	if Suite != "" {
 		version = Suite + " " + version
 	}
-	fmt.Printf(".TH \"%s\" 1 \"%s\" \"%s\" \"%s\"\n", progname,
+	fmt.Fprintf(Stdout, ".TH \"%s\" 1 \"%s\" \"%s\" \"%s\"\n", progname,
 		time.Now().Format("January 2, 2006"), version, Suite)
-	fmt.Println(".SH NAME")
-	fmt.Println(progname)
+	fmt.Fprintln(Stdout, ".SH NAME")
+	fmt.Fprintln(Stdout, progname)
 	if Summary != "" {
-		fmt.Println("\\-", Summary)
+		fmt.Fprintln(Stdout, "\\-", Summary)
 	}
-	fmt.Println(".SH SYNOPSIS")
-	fmt.Println(progname, Synopsis())
-	fmt.Println(".SH DESCRIPTION")
-	fmt.Println(formatParagraphs(Description()))
-	fmt.Println(".SH OPTIONS")
-	for _, o := range opts {
-		fmt.Println(".TP")
+	fmt.Fprintln(Stdout, ".SH SYNOPSIS")
+	fmt.Fprintln(Stdout, progname, Synopsis())
+	fmt.Fprintln(Stdout, ".SH DESCRIPTION")
+	fmt.Fprintln(Stdout, formatParagraphs(Description()))
+	fmt.Fprintln(Stdout, ".SH OPTIONS")
+	group := ""
+	for _, o := range byGroup() {
+		o, ok := o.visible()
+		if !ok {
+			continue
+		}
+		if o.group != group {
+			group = o.group
+			fmt.Fprintln(Stdout, ".SS", group)
+			if d := Expand(groupDescriptions[group]); d != "" {
+				fmt.Fprint(Stdout, formatParagraphs(d))
+			}
+		}
+		fmt.Fprintln(Stdout, ".TP")
 		switch {
 		case len(o.shortnames) == 0:
 			for _, n := range o.names[0 : len(o.names)-1] {
-				fmt.Printf("\\-\\-%s,", n[2:])
-			}
-			fmt.Printf("\\-\\-%s", o.names[len(o.names)-1][2:])
-			if o.allowsArg != nil {
-				fmt.Printf(" %s", *o.allowsArg)
+				fmt.Fprintf(Stdout, "\\-\\-%s,", n[2:])
 			}
+			fmt.Fprintf(Stdout, "\\-\\-%s", o.names[len(o.names)-1][2:])
+			fmt.Fprint(Stdout, o.argLabel(true, " "))
 		case len(o.names) == 0:
-			for _, c := range o.shortnames[0 : len(o.shortnames)-1] {
-				fmt.Printf("\\-%c,", c)
-			}
-			fmt.Printf("\\-%c", o.shortnames[len(o.shortnames)-1])
-			if o.allowsArg != nil {
-				fmt.Printf(" %s", *o.allowsArg)
+			for _, c := range o.shorts()[0 : len(o.shorts())-1] {
+				fmt.Fprintf(Stdout, "\\-%c,", c)
 			}
+			fmt.Fprintf(Stdout, "\\-%c", o.shorts()[len(o.shorts())-1])
+			fmt.Fprint(Stdout, o.argLabel(false, " "))
 		default:
 			for _, c := range o.shortnames {
-				fmt.Printf("\\-%c,", c)
+				fmt.Fprintf(Stdout, "\\-%c,", c)
 			}
 			for _, n := range o.names[0 : len(o.names)-1] {
-				fmt.Printf("\\-\\-%s,", n[2:])
-			}
-			fmt.Printf("\\-\\-%s", o.names[len(o.names)-1][2:])
-			if o.allowsArg != nil {
-				fmt.Printf(" %s", *o.allowsArg)
+				fmt.Fprintf(Stdout, "\\-\\-%s,", n[2:])
 			}
+			fmt.Fprintf(Stdout, "\\-\\-%s", o.names[len(o.names)-1][2:])
+			fmt.Fprint(Stdout, o.argLabel(true, " "))
 		}
-		fmt.Printf("\n%s\n", Expand(o.help))
+		fmt.Fprintf(Stdout, "\n%s\n", helpText(o))
 	}
 	if ExtraUsage != "" {
-		fmt.Println("\\-", ExtraUsage)
+		fmt.Fprintln(Stdout, "\\-", ExtraUsage)
+	}
+	for _, t := range helpTopics {
+		fmt.Fprintln(Stdout, ".SH", strings.ToUpper(t))
+		fmt.Fprint(Stdout, formatParagraphs(Expand(helpTopicText[t])))
+	}
+	if EnvironmentVariable != "" {
+		fmt.Fprintln(Stdout, ".SH ENVIRONMENT")
+		fmt.Fprintln(Stdout, ".TP")
+		fmt.Fprintln(Stdout, EnvironmentVariable)
+		fmt.Fprintln(Stdout, "Default options, split into words as by sh and placed before the command-line arguments.")
+	}
+	if len(deprecatedNames) > 0 {
+		fmt.Fprintln(Stdout, ".SH DEPRECATED OPTIONS")
+		for _, n := range deprecatedNames {
+			fmt.Fprintf(Stdout, ".TP\n%s\n", manName(n))
+			if r := deprecated[n]; r != "" {
+				fmt.Fprintf(Stdout, "Use %s instead.\n", manName(r))
+			} else {
+				fmt.Fprintln(Stdout, "To be removed.")
+			}
+		}
 	}
 	if Author != "" {
-		fmt.Printf(".SH AUTHOR\n%s\n", Author)
+		fmt.Fprintf(Stdout, ".SH AUTHOR\n%s\n", Author)
 	}
 }
 
+// manName escapes the dashes of a flag's name for the man page.
+func manName(n string) string {
+	return strings.Replace(n, "-", "\\-", -1)
+}
+
 func formatParagraphs(x string) string {
 	h := new(bytes.Buffer)
 	lines := strings.Split(x, "\n")
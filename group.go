@@ -0,0 +1,43 @@
+package goopt
+
+// Here we sort options into groups, each shown under its own heading
+// in the help and the man page.
+
+// groups holds the names of the groups, in the order they were made.
+var groups []string
+
+var groupDescriptions = make(map[string]string)
+
+// Put the named options in a group, which Help(), the man page and
+// WriteConfig show under a heading of its own, after the options that
+// aren't in any group.  Groups appear in the order they were first
+// named, and a description, if given, is shown beneath the heading.
+// Calling Group again with the same name adds more options to it.
+// Panics if there is no such option.
+func Group(name, description string, names ...string) {
+	if _, ok := groupDescriptions[name]; !ok {
+		append(&groups, name)
+	}
+	if description != "" || groupDescriptions[name] == "" {
+		groupDescriptions[name] = description
+	}
+	for _, n := range names {
+		mark(n, func(o *opt) { o.group = name })
+	}
+}
+
+// byGroup returns the options that aren't in a group followed by
+// those in each group in turn, otherwise in the order they were
+// defined.
+func byGroup() []opt {
+	out := make([]opt, 0, len(opts))
+	for _, g := range cat([]string{""}, groups) {
+		for _, o := range opts {
+			if o.group == g {
+				out = out[0 : len(out)+1]
+				out[len(out)-1] = o
+			}
+		}
+	}
+	return out
+}
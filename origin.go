@@ -0,0 +1,176 @@
+package goopt
+
+// Here we keep track of where the value of each option came from.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// An OriginKind says which mechanism last set an option.
+type OriginKind int
+
+const (
+	FromDefault     OriginKind = iota // the option was never set
+	FromConfig                        // set in a configuration file
+	FromEnvironment                   // set by an environment variable
+	FromCommandLine                   // set on the command line
+	FromResponseFile                  // set in a response file named on the command line
+)
+
+func (k OriginKind) String() string {
+	switch k {
+	case FromConfig:
+		return "config"
+	case FromEnvironment:
+		return "environment"
+	case FromCommandLine:
+		return "command line"
+	case FromResponseFile:
+		return "response file"
+	}
+	return "default"
+}
+
+// An Origin describes where the current value of an option came from.
+// Only the fields relevant to its Kind are filled in.
+type Origin struct {
+	Kind     OriginKind
+	File     string // the configuration or response file
+	Line     int    // the line within File
+	Variable string // the environment variable
+	Index    int    // the index into os.Args
+}
+
+func (o Origin) String() string {
+	switch o.Kind {
+	case FromConfig:
+		return fmt.Sprintf("config %s:%d", o.File, o.Line)
+	case FromEnvironment:
+		return "environment " + o.Variable
+	case FromCommandLine:
+		return fmt.Sprintf("command line argument %d", o.Index)
+	case FromResponseFile:
+		return fmt.Sprintf("response file %s:%d", o.File, o.Line)
+	}
+	return "default"
+}
+
+// prefix gives the location of an argument for use at the start of an
+// error message.  Arguments on the command line need no location.
+func (o Origin) prefix() string {
+	switch o.Kind {
+	case FromConfig, FromResponseFile:
+		return fmt.Sprintf("%s:%d: ", o.File, o.Line)
+	case FromEnvironment:
+		return "$" + o.Variable + ": "
+	}
+	return ""
+}
+
+func commandLine(i int) Origin {
+	return Origin{Kind: FromCommandLine, Index: i}
+}
+
+// lookup finds the option with the given name, e.g. "-v" or
+// "--verbose".  It returns false if there is no such option.
+func lookup(name string) (opt, bool) {
+	for _, o := range opts {
+		if o.has(name) {
+			return o, true
+		}
+	}
+	return opt{}, false
+}
+
+// Returns true if the named option was set by anything other than its
+// default, e.g. IsSet("--verbose")
+func IsSet(name string) bool {
+	return Source(name).Kind != FromDefault
+}
+
+// Returns where the current value of the named option came from.
+// Unknown options are reported as coming from their default.
+func Source(name string) Origin {
+	if o, ok := lookup(name); ok {
+		return o.value.origin
+	}
+	return Origin{}
+}
+
+// canonical returns the name we use to refer to an option in output
+// meant to be read back, preferring long names that aren't deprecated.
+func (o opt) canonical() string {
+	if v, _ := o.visible(); len(v.names) > 0 || len(v.shortnames) > 0 {
+		o = v // avoiding any deprecated names
+	}
+	if len(o.names) > 0 {
+		return o.names[0]
+	}
+	return "-" + string(o.shorts()[0])
+}
+
+// visitValues calls f once for each non-builtin option, group by
+// group, skipping the second half of a Flag, whose value is shared
+// with the first.
+func visitValues(f func(o opt)) {
+	done := make(map[*value]bool)
+	for _, o := range byGroup() {
+		if o.builtin != nil || done[o.value] {
+			continue
+		}
+		done[o.value] = true
+		f(o)
+	}
+}
+
+// Write the current value of every option, along with where it came
+// from, to w.  The format is either "text" or "json".
+func DumpConfig(w io.Writer, format string) error {
+	switch format {
+	case "text":
+		t := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		visitValues(func(o opt) {
+			v := strings.Join(o.current(), ",")
+			if o.value.secret {
+				v = "(secret)"
+			}
+			fmt.Fprintf(t, "%s\t%s\t%v\n", o.canonical(), v, o.value.origin)
+		})
+		return t.Flush()
+	case "json":
+		type entry struct {
+			Name     string      `json:"name"`
+			Value    interface{} `json:"value"`
+			Source   string      `json:"source"`
+			File     string      `json:"file,omitempty"`
+			Line     int         `json:"line,omitempty"`
+			Variable string      `json:"variable,omitempty"`
+			Index    int         `json:"index,omitempty"`
+		}
+		entries := make([]entry, 0, len(opts))
+		visitValues(func(o opt) {
+			var v interface{} = o.current()
+			switch {
+			case o.value.secret:
+				v = "(secret)"
+			case !o.value.multi && len(o.current()) == 1:
+				v = o.current()[0]
+			}
+			from := o.value.origin
+			entries = entries[0 : len(entries)+1]
+			entries[len(entries)-1] = entry{o.canonical(), v, from.Kind.String(),
+				from.File, from.Line, from.Variable, from.Index}
+		})
+		out, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+	}
+	return fmt.Errorf("unknown config format: %s", format)
+}
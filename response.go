@@ -0,0 +1,83 @@
+package goopt
+
+// Here we expand response files, which are named on the command line
+// as @file and hold further arguments.
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type expander struct {
+	args    []string
+	origins []Origin
+	open    map[string]bool // the files being read, to catch cycles
+	done    bool            // true once we have seen "--"
+}
+
+// expandResponseFiles replaces each @file argument with the arguments
+// held in file, returning the new arguments along with where each of
+// them came from.  Arguments after "--" are left alone, as are the
+// first literal ones, such as the program name.
+func expandResponseFiles(args []string, origins []Origin, literal int) ([]string, []Origin, error) {
+	e := expander{make([]string, 0, len(args)), make([]Origin, 0, len(args)),
+		make(map[string]bool), false}
+	for i, a := range args {
+		if i < literal {
+			append(&e.args, a)
+			appendOrigin(&e.origins, origins[i])
+		} else if err := e.add(a, origins[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return e.args, e.origins, nil
+}
+
+func (e *expander) add(a string, from Origin) error {
+	if e.done || len(a) < 2 || a[0] != '@' {
+		append(&e.args, a)
+		appendOrigin(&e.origins, from)
+		e.done = e.done || a == "--"
+		return nil
+	}
+	return e.include(a[1:], from)
+}
+
+// include adds the arguments in a response file.  Each line is split
+// into words as sh would, and everything from an unquoted # onwards
+// is a comment.  Relative names are taken relative to the current
+// directory, even when one response file includes another.
+func (e *expander) include(filename string, from Origin) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return fmt.Errorf("%s%v", from.prefix(), err)
+	}
+	if e.open[abs] {
+		return fmt.Errorf("%s@%s includes itself", from.prefix(), filename)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("%s%v", from.prefix(), err)
+	}
+	defer f.Close()
+	e.open[abs] = true
+	defer delete(e.open, abs)
+	lines := bufio.NewScanner(f)
+	for n := 1; lines.Scan(); n++ {
+		words, err := splitWords(lines.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", filename, n, err)
+		}
+		for _, w := range words {
+			if err := e.add(w, Origin{Kind: FromResponseFile, File: filename, Line: n}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
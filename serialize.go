@@ -0,0 +1,79 @@
+package goopt
+
+// Here we turn the current option values back into arguments.
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// isDefault returns true if the option still has its default setting.
+func (o opt) isDefault() bool {
+	cur := o.current()
+	switch {
+	case o.value.multi:
+		return len(cur) == 0
+	case o.value.get == nil:
+		return len(o.value.seen) == 0
+	}
+	return len(cur) == 1 && cur[0] == o.value.def
+}
+
+// Returns the arguments (without the program name) that would
+// reproduce the current value of every option that isn't at its
+// default, followed by Args.  Long names are used where possible.
+func Serialize() []string {
+	return serialize(false)
+}
+
+// Returns Serialize() quoted as for sh, which is handy for logging.
+// The values of secret options are replaced by "***".
+func SerializeString() string {
+	args := serialize(true)
+	for i, a := range args {
+		args[i] = shellQuote(a)
+	}
+	return strings.Join(args, " ")
+}
+
+func serialize(hideSecrets bool) []string {
+	out := make([]string, 0, len(opts)+len(Args))
+	experimental := false
+	visitValues(func(o opt) {
+		if o.isDefault() {
+			return
+		}
+		for _, words := range o.reproduce() {
+			experimental = experimental || o.experimental
+			if hideSecrets && o.value.secret && o.allowsArg != nil {
+				words = hideSecret(words)
+			}
+			for _, w := range words {
+				append(&out, w)
+			}
+		}
+	})
+	if experimental && experimentalAskedFor {
+		// the options given would be refused without it
+		out = cat([]string{ExperimentalFlag.Names[0]}, out)
+	}
+	for _, a := range Args {
+		if len(a) > 1 && (a[0] == '-' || ResponseFiles && a[0] == '@') {
+			append(&out, "--")
+			break
+		}
+	}
+	return cat(out, Args)
+}
+
+// hideSecret replaces the value in the words given by reproduce.
+func hideSecret(words []string) []string {
+	switch {
+	case len(words) > 1:
+		return []string{words[0], "***"}
+	case strings.HasPrefix(words[0], "--"):
+		return []string{words[0][0:strings.Index(words[0], "=")+1] + "***"}
+	}
+	_, size := utf8.DecodeRuneInString(words[0][1:]) // as in -cvalue
+	return []string{words[0][0:1+size] + "***"}
+}
@@ -0,0 +1,78 @@
+package goopt
+
+// Here we split and quote words the way a Bourne shell would.
+
+import (
+	"errors"
+	"strings"
+)
+
+// splitWords breaks a line into words much as sh would, honouring
+// single quotes, double quotes and backslash escapes, and dropping a
+// comment that starts with an unquoted # at the beginning of a word.
+func splitWords(line string) ([]string, error) {
+	words := make([]string, 0, 4)
+	word := new(strings.Builder)
+	inword := false
+	quote := rune(0)
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\"\\$`", c) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case quote == '"':
+			switch c {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(c)
+			}
+		case c == '\\':
+			escaped, inword = true, true
+		case c == '\'' || c == '"':
+			quote, inword = c, true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inword {
+				append(&words, word.String())
+				word.Reset()
+				inword = false
+			}
+		case c == '#' && !inword:
+			return words, nil
+		default:
+			word.WriteRune(c)
+			inword = true
+		}
+	}
+	switch {
+	case quote != 0:
+		return nil, errors.New("unterminated " + string(quote) + " quote")
+	case escaped:
+		return nil, errors.New("backslash at end of line")
+	case inword:
+		append(&words, word.String())
+	}
+	return words, nil
+}
+
+// shellQuote quotes a word so that sh (or splitWords) will read it
+// back unchanged.  Words that need no quoting are left alone.
+func shellQuote(w string) string {
+	if w != "" && strings.Trim(w, "abcdefghijklmnopqrstuvwxyz"+
+		"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+/.,:@%") == "" {
+		return w
+	}
+	return "'" + strings.Replace(w, "'", `'\''`, -1) + "'"
+}
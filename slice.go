@@ -48,3 +48,27 @@ func any(f func(string) bool, slice []string) bool {
 	}
 	return false
 }
+
+// appendOrigin is append for slices of Origin.
+func appendOrigin(slice *[]Origin, val Origin) {
+	length := len(*slice)
+	if cap(*slice) == length {
+		newsl := make([]Origin, length, 2*(length+1))
+		copy(newsl, *slice)
+		*slice = newsl
+	}
+	*slice = (*slice)[0 : length+1]
+	(*slice)[length] = val
+}
+
+// appendOption is append for slices of HelpOption.
+func appendOption(slice *[]HelpOption, val HelpOption) {
+	length := len(*slice)
+	if cap(*slice) == length {
+		newsl := make([]HelpOption, length, 2*(length+1))
+		copy(newsl, *slice)
+		*slice = newsl
+	}
+	*slice = (*slice)[0 : length+1]
+	(*slice)[length] = val
+}
@@ -0,0 +1,63 @@
+package goopt
+
+// Here we guess what was meant by a misspelt flag or value.
+
+import (
+	"strings"
+)
+
+// suggest returns the words that x is probably a misspelling of,
+// closest first.
+func suggest(x string, words []string) []string {
+	limit := len([]rune(strings.TrimLeft(x, "-"))) / 3
+	if limit < 1 {
+		limit = 1
+	}
+	distances := make([]int, len(words))
+	for i, w := range words {
+		distances[i] = editDistance(x, w)
+	}
+	out := make([]string, 0, 1)
+	for d := 0; d <= limit; d++ {
+		for i, w := range words {
+			if distances[i] == d {
+				append(&out, w)
+			}
+		}
+	}
+	return out
+}
+
+// editDistance counts the insertions, deletions, substitutions and
+// transpositions of adjacent characters needed to turn a into b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j-1] + cost
+			if d[i-1][j]+1 < d[i][j] {
+				d[i][j] = d[i-1][j] + 1
+			}
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] &&
+				d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
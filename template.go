@@ -0,0 +1,211 @@
+package goopt
+
+// Here we lay out the help from a template, which may be replaced.
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// HelpData is what the help templates are given to lay out.
+type HelpData struct {
+	Program             string
+	Summary             string
+	ExtraUsage          string
+	EnvironmentVariable string      // see EnvironmentVariable
+	Help                string      // the output of Help(), for the usage template
+	Groups              []HelpGroup // those options not in a group come first
+	Level               Level       // the most advanced options shown
+	LeftOut             Level       // the most advanced options left out, Basic if none
+	HelpFlag            string      // the name of the --help flag, or "" if it is disabled
+	Topics              []string    // the topics that --help=TOPIC knows about
+	Width               int         // see HelpWidth
+}
+
+// HelpGroup holds the options in one group (see Group), in the order
+// they were defined.
+type HelpGroup struct {
+	Name        string // "" for the options that aren't in a group
+	Description string
+	Options     []HelpOption
+	Column      int // where the help for the options starts, the same for every group
+	TextWidth   int // how wide the help for the options may be
+}
+
+// HelpOption describes one option that isn't hidden.
+type HelpOption struct {
+	Names        []string // e.g. -c --color, leaving out any deprecated names
+	Label        string   // the names as shown, e.g. "-c, --color[=WHEN]"
+	Arg          string   // the label of the argument, if there is one
+	ArgOptional  bool     // true if the argument may be left out
+	Help         string   // the help text, Expand()ed
+	Text         string   // the help text as Help() shows it (see helpText)
+	Default      string   // the default of the argument, if there is one
+	Env          string   // the environment variable that sets it (see Env)
+	Allowed      []string // the only arguments accepted, if limited
+	Group        string
+	Level        Level
+	Experimental bool
+}
+
+// Redefine this to change the layout of Usage() and Help().  Each of
+// the templates it defines replaces the one of the same name in
+// DefaultHelpTemplate, so it need only define those to be changed.
+var HelpTemplate = ""
+
+// DefaultHelpTemplate lays out Usage() and Help().  It defines the
+// templates "usage", which is given a HelpData, "help", which is given
+// the same but without Help filled in, and "options", which is given a
+// HelpGroup.  As well as those in HelpFuncs, templates may use the
+// functions wrap WIDTH TEXT, which gives the lines of TEXT wrapped to
+// WIDTH, pad WIDTH TEXT, which adds spaces to the end of TEXT to make
+// it WIDTH long, line TEXT..., which joins its arguments and drops any
+// spaces at the end, style KIND TEXT, which colours TEXT as the field
+// of Colors named in lower case by KIND if colour is wanted, join LIST
+// SEP, and sub.
+const DefaultHelpTemplate = `{{define "usage"}}{{style "heading" (printf "Usage of %s:" .Program)}}
+{{with .Summary}}	{{.}}{{end}}
+{{.Help}}{{with .EnvironmentVariable}}
+Default options may be given in ${{.}}.
+{{end}}{{if .HelpFlag}}{{if or .LeftOut .Topics}}
+{{end}}{{if and (eq .LeftOut.String "expert") (eq .Level.String "advanced")}}Use {{.HelpFlag}}=all to see the expert options too.
+{{else if .LeftOut}}Use {{.HelpFlag}} to see more options.
+{{end}}{{with .Topics}}Use {{$.HelpFlag}}=TOPIC for help on a topic: {{join . ", "}}.
+{{end}}{{end}}{{with .ExtraUsage}}{{.}}
+{{end}}{{end}}
+
+{{define "help"}}{{range $i, $g := .Groups}}{{if $i}}
+{{end}}{{if $g.Name}}{{style "heading" (printf "%s:" $g.Name)}}
+{{with $g.Description}}{{range wrap (sub $.Width 2) .}}{{line "  " .}}
+{{end}}{{end}}{{else}}{{style "heading" "Options:"}}
+{{end}}{{template "options" $g}}{{end}}{{end}}
+
+{{define "options"}}{{$g := .}}{{range .Options}}{{$o := .}}{{range $i, $l := wrap $g.TextWidth .Text}}{{if $i}}{{line (pad $g.Column "") $l}}{{else}}{{line (pad $g.Column (printf "  %s" $o.Label)) $l}}{{end}}
+{{end}}{{end}}{{end}}`
+
+// Redefine this to add to the functions that HelpTemplate may use
+var HelpFuncs = template.FuncMap{}
+
+// Returns what the templates are given to lay out Help(), for those who
+// would rather lay out the help themselves.
+func HelpModel() HelpData {
+	return helpModel(HelpLevel)
+}
+
+// helpModel gives what the templates are given to lay out the options
+// up to level.
+func helpModel(level Level) HelpData {
+	d := helpData(func(o opt) bool { return o.level <= level })
+	d.Level = level
+	return d
+}
+
+// usageAt lays out Usage() with the options up to level, as -h and
+// --help=all ask for, leaving HelpLevel alone.
+func usageAt(level Level) string {
+	d := helpModel(level)
+	d.Help = renderHelp("help", d)
+	return renderHelp("usage", d)
+}
+
+// helpData gathers the options that keep accepts, group by group, along
+// with everything else that the templates may need.
+func helpData(keep func(o opt) bool) HelpData {
+	d := HelpData{Program: programName(), Summary: Summary, ExtraUsage: ExtraUsage,
+		EnvironmentVariable: EnvironmentVariable, Level: HelpLevel,
+		Topics: cat(groups, helpTopics), Width: HelpWidth()}
+	if HelpFlag.Enabled && len(HelpFlag.Names) > 0 {
+		d.HelpFlag = HelpFlag.Names[0]
+	}
+	column := 0
+	d.Groups = make([]HelpGroup, 0, len(groups)+1)
+	for _, o := range byGroup() {
+		o, ok := o.visible()
+		switch {
+		case !ok:
+			continue
+		case !keep(o):
+			if o.level > d.LeftOut {
+				d.LeftOut = o.level
+			}
+			continue
+		case len(d.Groups) == 0 || d.Groups[len(d.Groups)-1].Name != o.group:
+			d.Groups = d.Groups[0 : len(d.Groups)+1]
+			d.Groups[len(d.Groups)-1] = HelpGroup{Name: o.group,
+				Description: Expand(groupDescriptions[o.group])}
+		}
+		g := &d.Groups[len(d.Groups)-1]
+		h := helpOption(o)
+		if n := visibleWidth(h.Label) + 2; n > column {
+			column = n
+		}
+		appendOption(&g.Options, h)
+	}
+	for i := range d.Groups {
+		d.Groups[i].Column, d.Groups[i].TextWidth = helpColumns(column)
+	}
+	return d
+}
+
+// helpColumns gives where the help for the options starts, for labels
+// up to the given width, and how wide it may be, which is never less
+// than 20 characters.
+func helpColumns(label int) (column, width int) {
+	column = label + 2
+	width = HelpWidth() - column
+	if width < 20 {
+		width = 20
+	}
+	return column, width
+}
+
+// helpOption describes an option for the templates.
+func helpOption(o opt) HelpOption {
+	h := HelpOption{Names: make([]string, 0, len(o.names)+len(o.shortnames)),
+		Label: helpLabel(o), Help: Expand(o.help), Text: helpText(o),
+		Env: o.env, Allowed: o.value.allowed,
+		Group: o.group, Level: o.level, Experimental: o.experimental}
+	for _, c := range o.shorts() {
+		append(&h.Names, "-"+string(c))
+	}
+	for _, n := range o.names {
+		append(&h.Names, n)
+	}
+	if o.allowsArg != nil {
+		h.Arg, h.ArgOptional, h.Default = o.label(), !o.needsArg, o.value.def
+	}
+	return h
+}
+
+// renderHelp lays out data using the named template, from HelpTemplate
+// or DefaultHelpTemplate.  Panics if the template is broken.
+func renderHelp(name string, data interface{}) string {
+	t, err := template.New("help").Funcs(template.FuncMap{
+		"wrap": func(width int, x string) []string { return wrapText(x, width) },
+		"pad": func(width int, x string) string {
+			if n := width - visibleWidth(x); n > 0 {
+				return x + strings.Repeat(" ", n)
+			}
+			return x
+		},
+		"line": func(xs ...string) string {
+			return strings.TrimRight(strings.Join(xs, ""), " ")
+		},
+		"join":  strings.Join,
+		"sub":   func(a, b int) int { return a - b },
+		"style": styleNamed,
+	}).Funcs(HelpFuncs).Parse(DefaultHelpTemplate)
+	if err == nil {
+		t, err = t.Parse(HelpTemplate)
+	}
+	if err != nil {
+		panic("Bad help template: " + err.Error())
+	}
+	b := new(bytes.Buffer)
+	if err := t.ExecuteTemplate(b, name, data); err != nil {
+		panic(fmt.Sprint("Bad help template: ", err))
+	}
+	return b.String()
+}
@@ -3,7 +3,11 @@ package main
 // test out the goopt package...
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	goopt "github.com/droundy/goopt"
 )
@@ -22,11 +26,155 @@ var speed = goopt.Alternatives([]string{"--speed", "--velocity"},
 var words = goopt.Strings([]string{"--word", "--saying", "-w", "-s"}, "word",
 	"specify a word to speak")
 
-var width = goopt.Int([]string{"-l", "--length"}, 1, "number of ?s")
+var password = goopt.String([]string{"--password"}, "", "a secret that is never written out, so it won't appear in --write-config, --print-config or the line saying how to reproduce this run\nBetter given in a config file than on the command line.")
+
+var color = "never"
+
+func init() {
+	goopt.OptArgWithLabel([]string{"-c", "--color", "--colour"}, "always", "WHEN", "colour the output: always, never or auto",
+		func(when string) error {
+			color = when
+			switch when {
+			case "always":
+				goopt.Color = goopt.ColorAlways
+			case "never":
+				goopt.Color = goopt.ColorNever
+			default:
+				goopt.Color = goopt.ColorAuto
+			}
+			return nil
+		})
+}
+
+var debug = goopt.Flag([]string{"--debug"}, nil, "show what is going on", "")
+var turbo = goopt.Flag([]string{"--turbo"}, nil, "go faster than is safe", "")
+
+var width = goopt.Int([]string{"-l", "-λ", "--length"}, 1, "number of ?s")
 
 func main() {
 	goopt.Summary = "silly test program"
+	goopt.Version = "0.1"
+	goopt.VersionFlag.Names = []string{"--version", "-V"}
+	goopt.VersionFlag.Handler = func(string) error {
+		fmt.Println("test-program version", goopt.Version)
+		os.Exit(0)
+		return nil
+	}
+	if os.Getenv("TEST_PROGRAM_CAPTURE") != "" {
+		captured := new(bytes.Buffer)
+		goopt.Stdout, goopt.Stderr = captured, captured
+		goopt.Exit = func(code int) {
+			fmt.Printf("Exit(%d) after %d bytes\n", code, captured.Len())
+		}
+	}
+	if os.Getenv("TEST_PROGRAM_VERBOSE_ERRORS") != "" {
+		goopt.FullUsageOnError = true
+		goopt.HelpOnError = true
+	}
+	if os.Getenv("TEST_PROGRAM_ON_ERROR") != "" {
+		goopt.OnError = func(err error) {
+			var bad *goopt.FlagError
+			if errors.As(err, &bad) {
+				fmt.Println("Flag:", bad.Flag, "Candidates:", strings.Join(bad.Candidates, " "))
+				fmt.Println("Suggestions:", strings.Join(bad.Suggestions, " "))
+			}
+			var invalid *goopt.ValueError
+			if errors.As(err, &invalid) {
+				fmt.Println("Value:", invalid.Value, "Suggestions:", strings.Join(invalid.Suggestions, " "))
+			}
+			os.Exit(2)
+		}
+	}
+	goopt.HelpFlag.Enabled = os.Getenv("TEST_PROGRAM_NO_HELP") == ""
+	goopt.PrintConfigFlag.Enabled = true
+	goopt.WriteConfigFlag.Enabled = true
+	goopt.ResponseFiles = true
+	goopt.AttachedOptArgs = os.Getenv("TEST_PROGRAM_ATTACHED") != ""
+	switch os.Getenv("TEST_PROGRAM_CONFLICT") {
+	case "error":
+		goopt.OnConflict = goopt.ErrorOnConflict
+		goopt.String([]string{"-b"}, "BAH!", "pick another scary sound")
+	case "panic":
+		goopt.OnConflict = goopt.PanicOnConflict
+		goopt.String([]string{"--name"}, "nobody", "pick your name again")
+	}
+	goopt.NegativeNumbers = os.Getenv("TEST_PROGRAM_NEGATIVE") != ""
+	if os.Getenv("TEST_PROGRAM_SHORT_OPTARG") != "" {
+		goopt.OptArg([]string{"-e"}, "hello", "echo a word", func(w string) error {
+			fmt.Println("Echo:", w)
+			return nil
+		})
+		if os.Getenv("TEST_PROGRAM_SHORT_OPTARG") == "secret" {
+			goopt.MarkSecret("-e")
+		}
+	}
+	if os.Getenv("TEST_PROGRAM_DIGIT_FLAG") != "" {
+		goopt.NoArg([]string{"-1"}, "say everything once", func() error {
+			fmt.Println("Once!")
+			return nil
+		})
+	}
+	if os.Getenv("TEST_PROGRAM_IN_ORDER") != "" {
+		goopt.ArgOrder = goopt.ReturnInOrder
+		goopt.HandleArg = func(arg string) error {
+			fmt.Println("Argument", arg, "follows", len(*words), "words")
+			return nil
+		}
+	}
+	goopt.EnvironmentVariable = "TEST_PROGRAM_OPTS"
+	goopt.MarkSecret("--password")
+	goopt.NoAbbreviation("--password")
+	goopt.Group("Speech", "What to say, and how fast to say it.", "--word", "--speed", "-l")
+	goopt.Group("Secrets", "", "--password")
+	goopt.SetLevel(goopt.Advanced, "--speed", "--password")
+	goopt.SetLevel(goopt.Expert, "-o")
+	if os.Getenv("TEST_PROGRAM_ADVANCED") != "" {
+		goopt.HelpLevel = goopt.Advanced
+	}
+	goopt.HelpTopic("sounds", "A scary sound is chosen with -b, and said once.\nAny sound may be given, but BOO! works best.")
+	goopt.BriefHelpFlag.Names = []string{"-H"}
+	goopt.Hide("--debug")
+	goopt.Deprecate("--colour", "--color")
+	goopt.Experimental("--turbo")
+	goopt.Env("--name", "TEST_PROGRAM_NAME")
+	goopt.Env("-b", "TEST_PROGRAM_BOO")
+	goopt.Env("--happy", "TEST_PROGRAM_HAPPY")
+	if os.Getenv("TEST_PROGRAM_TTY") != "" {
+		goopt.IsTerminal = func(io.Writer) bool { return true }
+	}
+	if os.Getenv("TEST_PROGRAM_COLOR_FLAG") != "" {
+		goopt.ColorFlag.Enabled = true
+		goopt.ColorFlag.Names = []string{"--highlight"}
+	}
+	if os.Getenv("TEST_PROGRAM_TEMPLATE") != "" {
+		goopt.HelpFuncs["upper"] = strings.ToUpper
+		goopt.HelpTemplate = `{{define "options"}}{{range .Options}}* {{join .Names " "}}` +
+			`{{with .Arg}} <{{upper .}}>{{end}}{{with .Default}} [{{.}}]{{end}}: {{.Help}}
+{{end}}{{end}}`
+	}
+	if os.Getenv("TEST_PROGRAM_SHOW") != "" {
+		goopt.ShowDefaults = true
+		goopt.ShowEnvVars = true
+		goopt.ShowAllowed = true
+		goopt.Label("--word", "WORD")
+	}
+	if os.Getenv("TEST_PROGRAM_STRICT") != "" {
+		goopt.MinAbbreviation = 3
+		goopt.WarnAbbreviations = true
+	}
+	if config := os.Getenv("TEST_PROGRAM_CONFIG"); config != "" {
+		if err := goopt.LoadConfig(config); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
 	goopt.Parse(nil)
+	if os.Getenv("TEST_PROGRAM_CAPTURE") != "" {
+		fmt.Println("Help level:", goopt.HelpLevel)
+	}
+	if late := os.Getenv("TEST_PROGRAM_LATE_ERROR"); late != "" {
+		goopt.OnError(errors.New(late))
+	}
 	if *amVerbose {
 		fmt.Println("I am verbose.")
 	}
@@ -50,4 +198,12 @@ func main() {
 	}
 	fmt.Println()
 	fmt.Printf("What's up, man%s\n", strings.Repeat("?", *width))
+	fmt.Println("Colour:", color)
+	if *debug {
+		fmt.Println("Debugging.")
+	}
+	if *turbo {
+		fmt.Println("Turbo!")
+	}
+	fmt.Println("Reproduce with:", goopt.SerializeString())
 }
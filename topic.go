@@ -0,0 +1,90 @@
+package goopt
+
+// Here we give help at different levels of detail, and on topics.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Level says how advanced an option is, and so when Help() shows it.
+type Level int
+
+const (
+	// Shown by the brief help of -h, as well as by --help.
+	Basic Level = iota
+	// Shown by --help, but not by -h.
+	Advanced
+	// Shown by --help unless HelpLevel leaves it out, and by --help=all.
+	Expert
+)
+
+// String gives the name of a Level in lower case, e.g. "expert".
+func (l Level) String() string {
+	switch l {
+	case Basic:
+		return "basic"
+	case Advanced:
+		return "advanced"
+	}
+	return "expert"
+}
+
+// Redefine this to change the most advanced options that Help() and
+// --help show.  Whatever it is, -h shows only the Basic options and
+// --help=all shows them all.
+var HelpLevel = Expert
+
+// helpTopics holds the names given to HelpTopic, in order, and
+// helpTopicText the text of each.
+var helpTopics []string
+
+var helpTopicText = make(map[string]string)
+
+// Set the level of the named options, which are Basic until then.
+// Panics if there is no such option.
+func SetLevel(level Level, names ...string) {
+	for _, n := range names {
+		mark(n, func(o *opt) { o.level = level })
+	}
+}
+
+// Add a page of help (automatically Expand()ed) on a topic, which is
+// shown by --help=name, and becomes a section of the man page.  Each
+// newline starts a new paragraph.
+func HelpTopic(name, text string) {
+	if _, ok := helpTopicText[name]; !ok {
+		append(&helpTopics, name)
+	}
+	helpTopicText[name] = text
+}
+
+// showHelp prints the help that --help asks for, either Usage(), or
+// the options in a group, or a page registered by HelpTopic.
+func showHelp(topic string) error {
+	defer paintingFor(Stdout)()
+	switch {
+	case topic == "":
+		fmt.Fprintln(Stdout, Usage())
+		exit(0)
+	case strings.EqualFold(topic, "all"):
+		fmt.Fprintln(Stdout, usageAt(Expert))
+		exit(0)
+	}
+	for _, g := range groups {
+		if strings.EqualFold(topic, g) {
+			fmt.Fprint(Stdout, renderHelp("help", helpData(func(o opt) bool { return o.group == g })))
+			exit(0)
+		}
+	}
+	for _, t := range helpTopics {
+		if strings.EqualFold(topic, t) {
+			for _, l := range wrapText(Expand(helpTopicText[t]), HelpWidth()) {
+				fmt.Fprintln(Stdout, l)
+			}
+			exit(0)
+		}
+	}
+	allowed := cat([]string{"all"}, groups, helpTopics)
+	return &ValueError{topic, allowed, suggest(topic, allowed)}
+}
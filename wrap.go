@@ -0,0 +1,41 @@
+package goopt
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Redefine this to change how many columns Help() may use, for
+// instance to ask the terminal itself.  The default reads $COLUMNS,
+// and falls back on 80.
+var HelpWidth = func() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+// wrapText breaks x into lines of at most width characters, except
+// where a single word is longer than that.  Each newline in x starts a
+// new paragraph, so there is always at least one line.
+func wrapText(x string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(x, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				append(&lines, line)
+				line = word
+			}
+		}
+		append(&lines, line)
+	}
+	return lines
+}